@@ -0,0 +1,135 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/base64"
+	"sync/atomic"
+
+	"filippo.io/edwards25519"
+	"golang.org/x/crypto/ed25519"
+)
+
+// batchResetInterval bounds how many candidate points we derive from a
+// single base scalar before reseeding with fresh randomness. This keeps
+// worst-case searches (e.g. a v3 prefix with no expected hit for a very
+// long time) from walking the orbit of one scalar forever, and avoids
+// biasing the distribution of secret keys a long-running search can land
+// on.
+const batchResetInterval = 1 << 22 // ~4.2M points per seed
+
+// ed25519Batch is a mkp224o-style vanity key batch: it generates one base
+// keypair (a, A = a*B) per seed and then walks the orbit A_i = A + i*B using
+// only point addition, which is far cheaper than the scalar multiplication
+// ed25519.GenerateKey performs per attempt. The secret scalar matching A_i
+// is a' = (a + i) mod L, which falls out of edwards25519.Scalar addition.
+type ed25519Batch struct {
+	a    *edwards25519.Scalar
+	rh   []byte // RH half of the expanded secret, unchanged across the batch
+	i    *edwards25519.Scalar
+	one  *edwards25519.Scalar
+	base *edwards25519.Point
+	cur  *edwards25519.Point
+}
+
+// newEd25519Batch seeds a fresh batch from crypto/rand.
+func newEd25519Batch() (*ed25519Batch, error) {
+	seed := make([]byte, 32)
+	if _, err := rand.Read(seed); err != nil {
+		return nil, err
+	}
+	h := sha512.Sum512(seed)
+	a, err := edwards25519.NewScalar().SetBytesWithClamping(h[:32])
+	if err != nil {
+		return nil, err
+	}
+	base := edwards25519.NewGeneratorPoint()
+	return &ed25519Batch{
+		a:    a,
+		rh:   append([]byte(nil), h[32:]...),
+		i:    edwards25519.NewScalar(),
+		one:  oneScalar(),
+		base: base,
+		cur:  edwards25519.NewIdentityPoint().ScalarBaseMult(a),
+	}, nil
+}
+
+// oneScalar returns the edwards25519 scalar 1.
+func oneScalar() *edwards25519.Scalar {
+	b := make([]byte, 32)
+	b[0] = 1
+	s, err := edwards25519.NewScalar().SetCanonicalBytes(b)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// Pub returns the 32-byte compressed public key for the current point.
+func (s *ed25519Batch) Pub() []byte {
+	return s.cur.Bytes()
+}
+
+// Onion returns the onion address for the current point.
+func (s *ed25519Batch) Onion() string {
+	return ed25519ToOnion(ed25519.PublicKey(s.Pub()))
+}
+
+// Secret returns the expanded secret (a' || RH) for the current point,
+// ready to write into hs_ed25519_secret_key.
+func (s *ed25519Batch) Secret() [64]byte {
+	aPrime := edwards25519.NewScalar().Add(s.a, s.i)
+	var secret [64]byte
+	copy(secret[:32], aPrime.Bytes())
+	copy(secret[32:], s.rh)
+	return secret
+}
+
+// Advance steps to the next point in the orbit: cur += base, i += 1.
+func (s *ed25519Batch) Advance() {
+	s.cur.Add(s.cur, s.base)
+	s.i.Add(s.i, s.one)
+}
+
+// ed25519BatchResult is a Result built from a matched point in an
+// ed25519Batch, without ever calling ed25519.GenerateKey.
+type ed25519BatchResult struct {
+	onion  string
+	secret [64]byte
+	pub    []byte
+}
+
+func (r *ed25519BatchResult) Onion() string {
+	return r.onion
+}
+
+func (r *ed25519BatchResult) PrivateKey() string {
+	b64 := base64.StdEncoding.EncodeToString(r.secret[:])
+	return "ED25519-V3:" + b64
+}
+
+func (r *ed25519BatchResult) WriteTorDir(dir string) error {
+	return writeEd25519TorDir(dir, r.onion, r.secret, r.pub)
+}
+
+// searchEd25519Batched is the batched equivalent of Search for the ed25519
+// key type: it reseeds a new ed25519Batch every batchResetInterval points
+// instead of calling keyFunc per attempt. attempts is bumped atomically so
+// progress reporting can read it without contending with the workers over
+// a channel.
+func searchEd25519Batched(matcher Matcher, results chan Result, attempts *uint64) {
+	for {
+		batch, err := newEd25519Batch()
+		if err != nil {
+			continue
+		}
+		for n := 0; n < batchResetInterval; n++ {
+			atomic.AddUint64(attempts, 1)
+			onion := batch.Onion()
+			if matcher.Match(onion) {
+				results <- &ed25519BatchResult{onion: onion, secret: batch.Secret(), pub: batch.Pub()}
+			}
+			batch.Advance()
+		}
+	}
+}
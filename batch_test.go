@@ -0,0 +1,63 @@
+package main
+
+import (
+	"crypto"
+	"testing"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+// TestEd25519BatchProducesSignableKeys walks an ed25519Batch through many
+// steps and checks, at each one, that Pub()/Secret() form a valid keypair:
+// a signature produced via newExpandedEd25519Signer (the a'=a+i scalar,
+// never a seed) verifies against the matching public key with stdlib
+// ed25519.Verify. This is the core correctness claim behind the batched
+// search: point addition tracks the secret scalar correctly at every step.
+func TestEd25519BatchProducesSignableKeys(t *testing.T) {
+	batch, err := newEd25519Batch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	const steps = 2000
+	message := []byte("onions batch correctness test")
+	for i := 0; i < steps; i++ {
+		pub := batch.Pub()
+		secret := batch.Secret()
+
+		signer, err := newExpandedEd25519Signer(secret, pub)
+		if err != nil {
+			t.Fatalf("step %d: newExpandedEd25519Signer: %v", i, err)
+		}
+		sig, err := signer.Sign(nil, message, crypto.Hash(0))
+		if err != nil {
+			t.Fatalf("step %d: Sign: %v", i, err)
+		}
+		if !ed25519.Verify(ed25519.PublicKey(pub), message, sig) {
+			t.Fatalf("step %d: signature does not verify for pub %x", i, pub)
+		}
+
+		batch.Advance()
+	}
+}
+
+// BenchmarkRandEd25519Result measures the cost of the naive path: a full
+// ed25519.GenerateKey (one scalar multiplication) per candidate.
+func BenchmarkRandEd25519Result(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		randEd25519Result()
+	}
+}
+
+// BenchmarkEd25519Batch measures the cost of the batched path: one scalar
+// multiplication per seed, amortized over batchResetInterval point
+// additions.
+func BenchmarkEd25519Batch(b *testing.B) {
+	batch, err := newEd25519Batch()
+	if err != nil {
+		b.Fatal(err)
+	}
+	for i := 0; i < b.N; i++ {
+		batch.Onion()
+		batch.Advance()
+	}
+}
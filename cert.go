@@ -0,0 +1,213 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"filippo.io/edwards25519"
+	"golang.org/x/crypto/ed25519"
+)
+
+// certValidity is how long the self-signed leaf certificate is valid for.
+const certValidity = 365 * 24 * time.Hour
+
+// writeTLSFiles writes tls.key, tls.crt and tls.csr into dir/<onion>/. The
+// certificate and its key are signed by leafSigner (the onion key itself,
+// or a fresh key when -cert-fresh-key is set); the CSR is always signed by
+// csrSigner, the onion's own key, so a verifier can confirm the requester
+// controls the hidden service.
+func writeTLSFiles(dir, onion string, leafSigner, csrSigner crypto.Signer, leafKeyPEM *pem.Block) error {
+	onion = strings.ToLower(onion)
+	hsDir := filepath.Join(dir, onion)
+	if err := os.MkdirAll(hsDir, 0700); err != nil {
+		return err
+	}
+
+	dnsName := onion + ".onion"
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return err
+	}
+	notBefore := time.Now().Add(-5 * time.Minute) // tolerate clock skew
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: dnsName},
+		DNSNames:     []string{dnsName},
+		NotBefore:    notBefore,
+		NotAfter:     notBefore.Add(certValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, leafSigner.Public(), leafSigner)
+	if err != nil {
+		return err
+	}
+	crtPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	if err := ioutil.WriteFile(filepath.Join(hsDir, "tls.crt"), crtPEM, 0600); err != nil {
+		return err
+	}
+
+	csrTemplate := &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: dnsName},
+		DNSNames: []string{dnsName},
+	}
+	csrDER, err := x509.CreateCertificateRequest(rand.Reader, csrTemplate, csrSigner)
+	if err != nil {
+		return err
+	}
+	csrPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csrDER})
+	if err := ioutil.WriteFile(filepath.Join(hsDir, "tls.csr"), csrPEM, 0600); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filepath.Join(hsDir, "tls.key"), pem.EncodeToMemory(leafKeyPEM), 0600)
+}
+
+// WriteCert writes a self-signed cert, key and CSR for the RSA onion key
+// into dir/<onion>/, reusing the onion's own 1024-bit RSA key throughout.
+func (r *rsaResult) WriteCert(dir string, freshKey bool) error {
+	keyPEM := &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(r.privateKey)}
+	return writeTLSFiles(dir, r.onion, r.privateKey, r.privateKey, keyPEM)
+}
+
+// WriteCert writes a self-signed cert, key and CSR bound to the ed25519
+// onion key. When freshKey is true the leaf certificate uses a freshly
+// generated ed25519 key with the onion address in its SAN, rather than the
+// hidden service key itself; the CSR is always signed by the onion key.
+func (r *ed25519Result) WriteCert(dir string, freshKey bool) error {
+	leaf, leafKeyPEM, err := ed25519LeafSigner(r.privateKey, freshKey)
+	if err != nil {
+		return err
+	}
+	return writeTLSFiles(dir, r.onion, leaf, r.privateKey, leafKeyPEM)
+}
+
+// WriteCert writes a self-signed cert, key and CSR bound to the ed25519
+// onion key found by the batched search. The CSR is signed using the
+// batch's expanded secret scalar directly, since a full ed25519.PrivateKey
+// seed is never generated for a batched candidate.
+//
+// Unlike ed25519Result, a batched result can never reuse its onion key as
+// the TLS leaf key: there is no seed the expanded scalar a'=a+i could be
+// the SHA-512 preimage of, so there is no standard-format ed25519 private
+// key to write to tls.key. The leaf certificate therefore always gets a
+// freshly generated key, regardless of freshKey; to reuse the onion key
+// directly, search with -batch=false instead.
+func (r *ed25519BatchResult) WriteCert(dir string, freshKey bool) error {
+	if !freshKey {
+		fmt.Fprintln(os.Stderr, "Note: batched ed25519 results have no standard-format private key to reuse; writing tls.key with a freshly generated key instead. Use -batch=false to reuse the onion key directly.")
+	}
+	csrSigner, err := newExpandedEd25519Signer(r.secret, r.pub)
+	if err != nil {
+		return err
+	}
+	leaf, leafKeyPEM, err := freshEd25519LeafKey()
+	if err != nil {
+		return err
+	}
+	return writeTLSFiles(dir, r.onion, leaf, csrSigner, leafKeyPEM)
+}
+
+// ed25519LeafSigner returns the crypto.Signer to use for the leaf
+// certificate: either the hidden service key itself, or a freshly generated
+// ed25519 key, along with the PEM block to persist it under tls.key.
+func ed25519LeafSigner(onionKey ed25519.PrivateKey, freshKey bool) (crypto.Signer, *pem.Block, error) {
+	if !freshKey {
+		return onionKey, &pem.Block{Type: "PRIVATE KEY", Bytes: marshalEd25519PKCS8(onionKey)}, nil
+	}
+	return freshEd25519LeafKey()
+}
+
+// freshEd25519LeafKey generates a new ed25519 keypair and PKCS#8-encodes
+// its private key for writing to tls.key.
+func freshEd25519LeafKey() (crypto.Signer, *pem.Block, error) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	return priv, &pem.Block{Type: "PRIVATE KEY", Bytes: marshalEd25519PKCS8(priv)}, nil
+}
+
+// marshalEd25519PKCS8 PKCS#8-encodes an ed25519 private key, falling back
+// to raw bytes if the standard marshaler rejects the key type.
+func marshalEd25519PKCS8(priv ed25519.PrivateKey) []byte {
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return priv
+	}
+	return der
+}
+
+// expandedEd25519Signer implements crypto.Signer for an ed25519 key that is
+// only known by its expanded secret (a || RH), as produced by the batched
+// vanity search, rather than by the 32-byte seed ed25519.PrivateKey expects.
+type expandedEd25519Signer struct {
+	a   *edwards25519.Scalar
+	rh  []byte
+	pub ed25519.PublicKey
+}
+
+func newExpandedEd25519Signer(secret [64]byte, pub []byte) (*expandedEd25519Signer, error) {
+	a, err := edwards25519.NewScalar().SetCanonicalBytes(secret[:32])
+	if err != nil {
+		return nil, err
+	}
+	return &expandedEd25519Signer{
+		a:   a,
+		rh:  append([]byte{}, secret[32:]...),
+		pub: append(ed25519.PublicKey{}, pub...),
+	}, nil
+}
+
+func (s *expandedEd25519Signer) Public() crypto.PublicKey {
+	return s.pub
+}
+
+func (s *expandedEd25519Signer) Sign(_ io.Reader, message []byte, _ crypto.SignerOpts) ([]byte, error) {
+	return ed25519RawSign(s.a, s.rh, s.pub, message), nil
+}
+
+// ed25519RawSign implements RFC 8032 Ed25519 signing directly from the
+// expanded secret scalar "a" and nonce seed "RH", without needing the
+// original 32-byte seed:
+//
+//	r = SHA-512(RH || M) mod L
+//	R = r*B
+//	k = SHA-512(R || A || M) mod L
+//	S = (k*a + r) mod L
+//	signature = R || S
+func ed25519RawSign(a *edwards25519.Scalar, rh, pub, message []byte) []byte {
+	h1 := sha512.New()
+	h1.Write(rh)
+	h1.Write(message)
+	digest1 := h1.Sum(nil)
+	r, _ := edwards25519.NewScalar().SetUniformBytes(digest1)
+	R := edwards25519.NewIdentityPoint().ScalarBaseMult(r)
+	RBytes := R.Bytes()
+
+	h2 := sha512.New()
+	h2.Write(RBytes)
+	h2.Write(pub)
+	h2.Write(message)
+	digest2 := h2.Sum(nil)
+	k, _ := edwards25519.NewScalar().SetUniformBytes(digest2)
+
+	s := edwards25519.NewScalar().MultiplyAdd(k, a, r)
+
+	sig := make([]byte, 64)
+	copy(sig[:32], RBytes)
+	copy(sig[32:], s.Bytes())
+	return sig
+}
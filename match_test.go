@@ -0,0 +1,54 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestWordMatcher(t *testing.T) {
+	tests := []struct {
+		mode  string
+		onion string
+		words []string
+		want  bool
+	}{
+		{"prefix", "ABCDEF", []string{"ABC"}, true},
+		{"prefix", "ABCDEF", []string{"BCD"}, false},
+		{"suffix", "ABCDEF", []string{"DEF"}, true},
+		{"suffix", "ABCDEF", []string{"ABC"}, false},
+		{"contains", "ABCDEF", []string{"CDE"}, true},
+		{"contains", "ABCDEF", []string{"XYZ"}, false},
+	}
+	for _, tt := range tests {
+		m := &wordMatcher{words: tt.words, mode: tt.mode}
+		if got := m.Match(tt.onion); got != tt.want {
+			t.Errorf("mode=%s onion=%s words=%v: got %v, want %v", tt.mode, tt.onion, tt.words, got, tt.want)
+		}
+	}
+}
+
+func TestRegexMatcher(t *testing.T) {
+	m := &regexMatcher{patterns: []*regexp.Regexp{regexp.MustCompile("^love.*cat$")}}
+	if !m.Match("LOVEXXXCAT") {
+		t.Error("expected regex to match against the lowercased onion")
+	}
+	if m.Match("DOGXXXCAT") {
+		t.Error("expected regex not to match")
+	}
+}
+
+func TestMultiMatcherOrsSubMatchers(t *testing.T) {
+	m := multiMatcher{
+		&wordMatcher{words: []string{"ABC"}, mode: "prefix"},
+		&regexMatcher{patterns: []*regexp.Regexp{regexp.MustCompile("xyz$")}},
+	}
+	if !m.Match("ABCDEF") {
+		t.Error("expected word match to count")
+	}
+	if !m.Match("defxyz") {
+		t.Error("expected regex match to count")
+	}
+	if m.Match("nothingmatches") {
+		t.Error("expected no match")
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"encoding/asn1"
 	"encoding/base32"
 	"encoding/base64"
+	"encoding/pem"
 	"flag"
 	"fmt"
 	"golang.org/x/crypto/ed25519"
@@ -19,14 +20,36 @@ import (
 	"io/ioutil"
 	"net/http"
 	"os"
+	"path/filepath"
+	"regexp"
 	"runtime"
 	"strings"
+	"sync/atomic"
+	"time"
 	"log"
 )
 
+// ed25519SecretHeader/ed25519PublicHeader are the ASCII headers Tor itself
+// writes at the start of hs_ed25519_secret_key/hs_ed25519_public_key,
+// followed by three NUL padding bytes.
+const (
+	ed25519SecretHeader = "== ed25519v1-secret: type0 ==\x00\x00\x00"
+	ed25519PublicHeader = "== ed25519v1-public: type0 ==\x00\x00\x00"
+)
+
 type Result interface {
 	Onion() string
 	PrivateKey() string
+	// WriteTorDir writes the key material into dir/<onion>/ using the same
+	// file layout Tor itself writes under HiddenServiceDir, so the result
+	// can be dropped straight in without any conversion step.
+	WriteTorDir(dir string) error
+	// WriteCert writes a self-signed tls.crt/tls.key and a tls.csr bound to
+	// the onion key into dir/<onion>/. When freshKey is true the leaf
+	// certificate uses a freshly generated key with the onion address in
+	// its SAN instead of reusing the onion key directly; the CSR is always
+	// signed by the onion key itself.
+	WriteCert(dir string, freshKey bool) error
 }
 
 type rsaResult struct {
@@ -58,6 +81,23 @@ func (r *rsaResult) PrivateKey() string {
 	return "RSA1024:" + b64
 }
 
+// WriteTorDir writes private_key and hostname into dir/<onion>/, matching
+// the layout of a v2 HiddenServiceDir.
+func (r *rsaResult) WriteTorDir(dir string) error {
+	onion := strings.ToLower(r.onion)
+	hsDir := filepath.Join(dir, onion)
+	if err := os.MkdirAll(hsDir, 0700); err != nil {
+		return err
+	}
+	der := x509.MarshalPKCS1PrivateKey(r.privateKey)
+	block := &pem.Block{Type: "RSA PRIVATE KEY", Bytes: der}
+	if err := ioutil.WriteFile(filepath.Join(hsDir, "private_key"), pem.EncodeToMemory(block), 0600); err != nil {
+		return err
+	}
+	hostname := onion + ".onion\n"
+	return ioutil.WriteFile(filepath.Join(hsDir, "hostname"), []byte(hostname), 0600)
+}
+
 type ed25519Result struct {
 	onion      string
 	privateKey ed25519.PrivateKey
@@ -73,14 +113,48 @@ func (r *ed25519Result) Onion() string {
 }
 
 func (r *ed25519Result) PrivateKey() string {
-	h := sha512.Sum512(r.privateKey[:32])
-	// Set bits so that h[:32] is private scalar "a"
+	h := expandEd25519Seed(r.privateKey[:32])
+	b64 := base64.StdEncoding.EncodeToString(h[:])
+	return "ED25519-V3:" + b64
+}
+
+// WriteTorDir writes hs_ed25519_secret_key, hs_ed25519_public_key and
+// hostname into dir/<onion>/, matching the layout of a v3 HiddenServiceDir.
+func (r *ed25519Result) WriteTorDir(dir string) error {
+	h := expandEd25519Seed(r.privateKey[:32])
+	return writeEd25519TorDir(dir, r.onion, h, r.privateKey[32:])
+}
+
+// expandEd25519Seed turns a 32-byte ed25519 seed into the expanded secret
+// (a || RH) used by Tor: h = SHA-512(seed), with the standard bit clamping
+// applied so that h[:32] is the private scalar "a" and h[32:] is "RH".
+func expandEd25519Seed(seed []byte) [64]byte {
+	h := sha512.Sum512(seed)
 	h[0] &= 248
 	h[31] &= 127
 	h[31] |= 64
-	// Since h[32:] is RH, h is now (a || RH)
-	b64 := base64.StdEncoding.EncodeToString(h[:])
-	return "ED25519-V3:" + b64
+	return h
+}
+
+// writeEd25519TorDir writes the hs_ed25519_secret_key, hs_ed25519_public_key
+// and hostname files Tor itself writes under a v3 HiddenServiceDir, given
+// the expanded secret (a || RH) and the raw 32-byte public key.
+func writeEd25519TorDir(dir, onion string, secret [64]byte, pub []byte) error {
+	onion = strings.ToLower(onion)
+	hsDir := filepath.Join(dir, onion)
+	if err := os.MkdirAll(hsDir, 0700); err != nil {
+		return err
+	}
+	secretFile := append([]byte(ed25519SecretHeader), secret[:]...)
+	if err := ioutil.WriteFile(filepath.Join(hsDir, "hs_ed25519_secret_key"), secretFile, 0600); err != nil {
+		return err
+	}
+	publicFile := append([]byte(ed25519PublicHeader), pub...)
+	if err := ioutil.WriteFile(filepath.Join(hsDir, "hs_ed25519_public_key"), publicFile, 0600); err != nil {
+		return err
+	}
+	hostname := onion + ".onion\n"
+	return ioutil.WriteFile(filepath.Join(hsDir, "hostname"), []byte(hostname), 0600)
 }
 
 func ed25519ToOnion(pub ed25519.PublicKey) string {
@@ -101,19 +175,78 @@ func ed25519Checkdigits(pub ed25519.PublicKey) []byte {
 	return checksum[:2]
 }
 
-// Endlessly generate random onion addresses and check them against the words
-// array looking for prefix matches.
-func Search(keyFunc func()Result, words []string, results chan Result) {
-	for {
-		r := keyFunc()
-		onion := r.Onion()
-		for _, word := range words {
+// Matcher decides whether a generated onion address is a hit.
+type Matcher interface {
+	Match(onion string) bool
+}
+
+// wordMatcher matches onions against a dictionary word list using one of
+// the prefix/suffix/contains modes.
+type wordMatcher struct {
+	words []string
+	mode  string
+}
+
+func (m *wordMatcher) Match(onion string) bool {
+	for _, word := range m.words {
+		switch m.mode {
+		case "suffix":
+			if strings.HasSuffix(onion, word) {
+				return true
+			}
+		case "contains":
+			if strings.Contains(onion, word) {
+				return true
+			}
+		default:
 			if strings.HasPrefix(onion, word) {
-				results <- r
-				break
+				return true
 			}
 		}
 	}
+	return false
+}
+
+// regexMatcher matches onions against a set of compiled regular expressions.
+// Patterns are matched against the lowercase onion address, since that's
+// the form the tool prints and saves results under.
+type regexMatcher struct {
+	patterns []*regexp.Regexp
+}
+
+func (m *regexMatcher) Match(onion string) bool {
+	onion = strings.ToLower(onion)
+	for _, pattern := range m.patterns {
+		if pattern.MatchString(onion) {
+			return true
+		}
+	}
+	return false
+}
+
+// multiMatcher ORs together any number of matchers.
+type multiMatcher []Matcher
+
+func (m multiMatcher) Match(onion string) bool {
+	for _, matcher := range m {
+		if matcher.Match(onion) {
+			return true
+		}
+	}
+	return false
+}
+
+// Endlessly generate random onion addresses and check them against matcher.
+// attempts is bumped atomically so progress reporting can read it without
+// contending with the workers over a channel.
+func Search(keyFunc func() Result, matcher Matcher, results chan Result, attempts *uint64) {
+	for {
+		r := keyFunc()
+		atomic.AddUint64(attempts, 1)
+		if matcher.Match(r.Onion()) {
+			results <- r
+		}
+	}
 }
 
 // Read a local dictionary file.
@@ -131,6 +264,18 @@ func readDictUrl(dictUrl string) []string {
 	return strings.Fields(body)
 }
 
+// patternList collects repeated -pattern flags into a slice of strings.
+type patternList []string
+
+func (p *patternList) String() string {
+	return strings.Join(*p, ",")
+}
+
+func (p *patternList) Set(value string) error {
+	*p = append(*p, value)
+	return nil
+}
+
 func main() {
 
 	var minSize int
@@ -145,6 +290,27 @@ func main() {
 	var keyType string
 	flag.StringVar(&keyType, "key", "rsa", "Type of key (rsa or ed25519)")
 
+	var outMode string
+	flag.StringVar(&outMode, "out", "file", "Output format (file or tordir)")
+
+	var mode string
+	flag.StringVar(&mode, "mode", "prefix", "Dictionary match mode (prefix, suffix or contains)")
+
+	var patterns patternList
+	flag.Var(&patterns, "pattern", "Regexp to match against onion address (may be repeated)")
+
+	var doCert bool
+	flag.BoolVar(&doCert, "cert", false, "Generate a self-signed TLS cert/key/CSR bound to the onion key")
+
+	var certFreshKey bool
+	flag.BoolVar(&certFreshKey, "cert-fresh-key", false, "Use a freshly generated TLS key with the onion address as SAN, instead of reusing the onion key")
+
+	var jsonOut bool
+	flag.BoolVar(&jsonOut, "json", false, "Emit each hit as one JSON object per line on stdout")
+
+	var batched bool
+	flag.BoolVar(&batched, "batch", true, "For -key=ed25519, use the batched base-point-addition search. Disable to fall back to the naive per-attempt generator, e.g. so -cert can reuse the onion key directly as tls.key")
+
 	flag.Parse()
 	
 	var words []string
@@ -159,44 +325,102 @@ func main() {
 		log.Fatal("Unrecognized key type: " + keyType)
 	}
 
-	if len(dictFile) == 0 && len(dictUrl) == 0 {
-		fmt.Println("No dictionary supplied. See --help for usage.")
+	if len(dictFile) == 0 && len(dictUrl) == 0 && len(patterns) == 0 {
+		fmt.Println("No dictionary or pattern supplied. See --help for usage.")
 		return
-	} else {
+	}
+
+	if len(dictFile) > 0 || len(dictUrl) > 0 {
 		fmt.Printf("Loading dictionary... ")
 		if len(dictFile) > 0 {
 			words = readDictFile(dictFile)
 		} else if len(dictUrl) > 0 {
 			words = readDictUrl(dictUrl)
 		}
+
+		// Filter by minimum size and convert to uppercase
+		var filtered []string
+		for _, word := range words {
+			if len(word) >= minSize {
+				filtered = append(filtered, strings.ToUpper(word))
+			}
+		}
+		words = filtered
+		fmt.Println(len(words), "words found.")
 	}
 
-	// Filter by minimum size and convert to uppercase
-	var filtered []string
-	for _, word := range words {
-		if len(word) >= minSize {
-			filtered = append(filtered, strings.ToUpper(word))
+	var matchers multiMatcher
+	if len(words) > 0 {
+		matchers = append(matchers, &wordMatcher{words: words, mode: strings.ToLower(mode)})
+	}
+	if len(patterns) > 0 {
+		compiled := make([]*regexp.Regexp, 0, len(patterns))
+		for _, pattern := range patterns {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				log.Fatal("Invalid -pattern: " + err.Error())
+			}
+			compiled = append(compiled, re)
 		}
+		matchers = append(matchers, &regexMatcher{patterns: compiled})
 	}
-	words = filtered
+	if len(matchers) == 0 {
+		fmt.Println("No words or patterns to match. See --help for usage.")
+		return
+	}
+	var matcher Matcher = matchers
 
-	fmt.Println(len(words), "words found.")
 	fmt.Println("Searching...")
 
+	onionLen := onionLenV2
+	if keyType == "ed25519" {
+		onionLen = onionLenV3
+	}
+
+	numWorkers := runtime.NumCPU()
+	var attempts uint64
+	start := time.Now()
+	go reportProgress(&attempts, numWorkers, matchProbability(words, strings.ToLower(mode), onionLen), start)
+
 	// Start up the goroutines
 	results := make(chan Result)
-	for i := 0; i < runtime.NumCPU(); i++ {
-		go Search(keyFunc, words, results)
+	for i := 0; i < numWorkers; i++ {
+		if keyType == "ed25519" && batched {
+			// The batched search amortizes the scalar multiplication
+			// ed25519.GenerateKey would otherwise do on every attempt, at
+			// the cost of never holding a seed-based ed25519.PrivateKey for
+			// a hit (see ed25519BatchResult.WriteCert). Pass -batch=false
+			// to fall back to the naive generator below when that matters.
+			go searchEd25519Batched(matcher, results, &attempts)
+		} else {
+			go Search(keyFunc, matcher, results, &attempts)
+		}
 	}
 
 	os.MkdirAll("./keys", os.ModePerm)
 
+	outMode = strings.ToLower(outMode)
 	for r := range results {
 		onion := strings.ToLower(r.Onion())
-		privateKey := r.PrivateKey()
-		fmt.Println(onion)
-		f, _ := os.Create("./keys/" + onion + ".onion")
-		f.WriteString(privateKey)
-		f.Sync()
+		if jsonOut {
+			printJSONHit(r, matcher, &attempts, start)
+		} else {
+			fmt.Println(onion)
+		}
+		if outMode == "tordir" {
+			if err := r.WriteTorDir("./keys"); err != nil {
+				log.Println("Failed to write tordir for", onion, ":", err)
+			}
+		} else {
+			privateKey := r.PrivateKey()
+			f, _ := os.Create("./keys/" + onion + ".onion")
+			f.WriteString(privateKey)
+			f.Sync()
+		}
+		if doCert {
+			if err := r.WriteCert("./keys", certFreshKey); err != nil {
+				log.Println("Failed to write cert for", onion, ":", err)
+			}
+		}
 	}
 }
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Onion address lengths, used to count the valid start positions for
+// -mode=contains.
+const (
+	onionLenV2 = 16 // base32(80-bit SHA-1 half)
+	onionLenV3 = 56 // base32(32-byte pubkey + 2-byte checksum + 1-byte version)
+)
+
+// matchProbability estimates the probability that a single random onion
+// address of length onionLen matches matcher, so progress reporting can
+// give an ETA. Each word is assumed independent with probability 32^-len
+// (the odds of len matching base32 characters landing at a fixed
+// position); prefix and suffix modes have exactly one such position, while
+// contains has one per valid starting offset, so its probability is scaled
+// by (onionLen-len+1). Regex patterns can't be estimated this way and are
+// ignored.
+func matchProbability(words []string, mode string, onionLen int) float64 {
+	var sum float64
+	for _, word := range words {
+		p := math.Pow(32, -float64(len(word)))
+		if mode == "contains" {
+			positions := onionLen - len(word) + 1
+			if positions < 1 {
+				positions = 1
+			}
+			p *= float64(positions)
+			if p > 1 {
+				p = 1
+			}
+		}
+		sum += p
+	}
+	return sum
+}
+
+// formatETA estimates the time to the next hit given the current attempt
+// rate and the probability a single attempt matches.
+func formatETA(attemptsPerSec, probability float64) string {
+	if probability <= 0 || attemptsPerSec <= 0 {
+		return "unknown"
+	}
+	expectedAttempts := 1 / probability
+	seconds := expectedAttempts / attemptsPerSec
+	return time.Duration(seconds * float64(time.Second)).Round(time.Second).String()
+}
+
+// reportProgress prints a stderr progress line every second: total
+// attempts, aggregate and per-core rate, elapsed time, and an ETA to the
+// next hit based on probability.
+func reportProgress(attempts *uint64, numWorkers int, probability float64, start time.Time) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	var last uint64
+	for range ticker.C {
+		current := atomic.LoadUint64(attempts)
+		rate := current - last
+		last = current
+		perCore := rate / uint64(numWorkers)
+		elapsed := time.Since(start).Round(time.Second)
+		eta := formatETA(float64(rate), probability)
+		fmt.Fprintf(os.Stderr, "\rattempts=%d rate=%d/s per-core=%d/s elapsed=%s eta=%s   ",
+			current, rate, perCore, elapsed, eta)
+	}
+}
+
+// jsonHit is the structured form of a hit emitted with -json, one object
+// per line so the tool composes into pipelines and daemons.
+type jsonHit struct {
+	Onion        string `json:"onion"`
+	SecretKeyB64 string `json:"secret_key_b64"`
+	Matched      string `json:"matched"`
+	Attempts     uint64 `json:"attempts"`
+	ElapsedMs    int64  `json:"elapsed_ms"`
+}
+
+// printJSONHit writes a jsonHit for r as one JSON line on stdout.
+func printJSONHit(r Result, matcher Matcher, attempts *uint64, start time.Time) {
+	secretKeyB64 := r.PrivateKey()
+	if i := strings.IndexByte(secretKeyB64, ':'); i >= 0 {
+		secretKeyB64 = secretKeyB64[i+1:]
+	}
+	hit := jsonHit{
+		Onion:        strings.ToLower(r.Onion()),
+		SecretKeyB64: secretKeyB64,
+		Matched:      describeMatch(matcher, r.Onion()),
+		Attempts:     atomic.LoadUint64(attempts),
+		ElapsedMs:    time.Since(start).Milliseconds(),
+	}
+	data, err := json.Marshal(hit)
+	if err != nil {
+		return
+	}
+	fmt.Println(string(data))
+}
+
+// describeMatch reports which word or pattern matched onion, for inclusion
+// in -json output.
+func describeMatch(m Matcher, onion string) string {
+	switch v := m.(type) {
+	case multiMatcher:
+		for _, sub := range v {
+			if desc := describeMatch(sub, onion); desc != "" {
+				return desc
+			}
+		}
+	case *wordMatcher:
+		for _, word := range v.words {
+			switch v.mode {
+			case "suffix":
+				if strings.HasSuffix(onion, word) {
+					return word
+				}
+			case "contains":
+				if strings.Contains(onion, word) {
+					return word
+				}
+			default:
+				if strings.HasPrefix(onion, word) {
+					return word
+				}
+			}
+		}
+	case *regexMatcher:
+		lower := strings.ToLower(onion)
+		for _, pattern := range v.patterns {
+			if pattern.MatchString(lower) {
+				return pattern.String()
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func mustGenerateRSAKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestWriteTorDirEd25519(t *testing.T) {
+	r := &ed25519Result{
+		onion:      "EXAMPLEONION",
+		privateKey: make([]byte, 64),
+	}
+	for i := range r.privateKey {
+		r.privateKey[i] = byte(i)
+	}
+
+	dir := t.TempDir()
+	if err := r.WriteTorDir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	secret, err := ioutil.ReadFile(filepath.Join(dir, "exampleonion", "hs_ed25519_secret_key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(secret) != len(ed25519SecretHeader)+64 {
+		t.Fatalf("hs_ed25519_secret_key length = %d, want %d", len(secret), len(ed25519SecretHeader)+64)
+	}
+	if string(secret[:len(ed25519SecretHeader)]) != ed25519SecretHeader {
+		t.Fatalf("hs_ed25519_secret_key header = %q, want %q", secret[:len(ed25519SecretHeader)], ed25519SecretHeader)
+	}
+
+	public, err := ioutil.ReadFile(filepath.Join(dir, "exampleonion", "hs_ed25519_public_key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(public) != len(ed25519PublicHeader)+32 {
+		t.Fatalf("hs_ed25519_public_key length = %d, want %d", len(public), len(ed25519PublicHeader)+32)
+	}
+	if string(public[:len(ed25519PublicHeader)]) != ed25519PublicHeader {
+		t.Fatalf("hs_ed25519_public_key header = %q, want %q", public[:len(ed25519PublicHeader)], ed25519PublicHeader)
+	}
+
+	hostname, err := ioutil.ReadFile(filepath.Join(dir, "exampleonion", "hostname"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(hostname) != "exampleonion.onion\n" {
+		t.Fatalf("hostname = %q, want %q", hostname, "exampleonion.onion\n")
+	}
+}
+
+func TestWriteTorDirRSA(t *testing.T) {
+	r := &rsaResult{onion: "RSAONION"}
+	r.privateKey = mustGenerateRSAKey(t)
+
+	dir := t.TempDir()
+	if err := r.WriteTorDir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ioutil.ReadFile(filepath.Join(dir, "rsaonion", "private_key")); err != nil {
+		t.Fatal(err)
+	}
+	hostname, err := ioutil.ReadFile(filepath.Join(dir, "rsaonion", "hostname"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(hostname) != "rsaonion.onion\n" {
+		t.Fatalf("hostname = %q, want %q", hostname, "rsaonion.onion\n")
+	}
+}